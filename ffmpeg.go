@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeglimit"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/stderrtail"
+)
+
+// newFFmpegSem returns a semaphore sized to the host's CPU count, so
+// concurrent uploads, HLS transcodes, and peak extractions don't together
+// spawn unbounded ffmpeg/ffprobe processes and thrash the machine. Called
+// once when building apiConfig; cfg.ffmpegSem is shared by every package
+// that shells out to ffmpeg/ffprobe.
+func newFFmpegSem() *ffmpeglimit.Semaphore {
+	return ffmpeglimit.New(runtime.NumCPU())
+}
+
+// acquireFFmpegSlot blocks until a slot in cfg.ffmpegSem is free, or ctx is
+// done (e.g. the HTTP client disconnected).
+func acquireFFmpegSlot(ctx context.Context, cfg *apiConfig) error {
+	return cfg.ffmpegSem.Acquire(ctx)
+}
+
+func releaseFFmpegSlot(cfg *apiConfig) {
+	cfg.ffmpegSem.Release()
+}
+
+// processVideoForFastStart uses ffmpeg to re-order the metadata in the video
+// so that the movflags appear at the beginning of the file, removing the
+// need for two requests to preload the video content in the browser. It
+// respects ctx (killing ffmpeg if the client disconnects) and cfg.ffmpegSem
+// (bounding how many ffmpeg processes run at once).
+func processVideoForFastStart(ctx context.Context, cfg *apiConfig, filepath string) (string, error) {
+	if err := acquireFFmpegSlot(ctx, cfg); err != nil {
+		return "", fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer releaseFFmpegSlot(cfg)
+
+	outputFilepath := filepath + ".processing"
+	var stderr stderrtail.Tail
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", filepath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilepath)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg faststart: %w: %s", err, stderr.String())
+	}
+	return outputFilepath, nil
+}
+
+// getVideoAspectRatio retrieves the video's aspect ratio from its metadata
+// using ffprobe. It respects ctx and cfg.ffmpegSem like
+// processVideoForFastStart.
+func getVideoAspectRatio(ctx context.Context, cfg *apiConfig, filePath string) (string, error) {
+	if err := acquireFFmpegSlot(ctx, cfg); err != nil {
+		return "", fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer releaseFFmpegSlot(cfg)
+
+	type videoData struct {
+		Streams []struct {
+			Width              int    `json:"width"`
+			Height             int    `json:"height"`
+			DisplayAspectRatio string `json:"display_aspect_ratio"`
+		} `json:"streams"`
+	}
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	var stdout bytes.Buffer
+	var stderr stderrtail.Tail
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffprobe: %w: %s", err, stderr.String())
+	}
+
+	var data videoData
+	if err := json.Unmarshal(stdout.Bytes(), &data); err != nil {
+		return "", fmt.Errorf("parse ffprobe output: %w", err)
+	}
+	if len(data.Streams) == 0 {
+		return "", fmt.Errorf("no video stream found")
+	}
+
+	ratio := data.Streams[0].DisplayAspectRatio
+	if ratio == "16:9" {
+		return "landscape", nil
+	} else if ratio == "9:16" {
+		return "portrait", nil
+	} else {
+		return "other", nil
+	}
+}
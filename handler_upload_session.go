@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/uploadsession"
+	"github.com/google/uuid"
+)
+
+// maxUploadPartSize bounds a single PATCH body; the client is expected to
+// chunk large videos into parts around this size.
+const maxUploadPartSize = 16 << 20 // 16MiB
+
+// handlerInitUploadSession handles POST /api/videos/{videoID}/upload/init.
+// It opens an S3 multipart upload and a resumable session tracking its
+// parts, and returns the session ID the client uses for subsequent
+// PATCH/complete calls.
+func (cfg *apiConfig) handlerInitUploadSession(w http.ResponseWriter, r *http.Request) {
+	videoID, err := getVideoID(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to upload this video", nil)
+		return
+	}
+
+	keyBytes := make([]byte, 16)
+	_, _ = rand.Read(keyBytes)
+	rawKey := fmt.Sprintf("uploads/%s/%x.mp4", videoID, keyBytes)
+
+	created, err := cfg.s3Client.CreateMultipartUpload(r.Context(), &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(rawKey),
+		ContentType: aws.String("video/mp4"),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start multipart upload", err)
+		return
+	}
+
+	session := &uploadsession.Session{
+		ID:       uuid.New().String(),
+		VideoID:  videoID.String(),
+		S3Key:    rawKey,
+		UploadID: aws.ToString(created.UploadId),
+	}
+	if err := cfg.uploadSessions.Create(session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload session", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		SessionID string `json:"sessionID"`
+	}{SessionID: session.ID})
+}
+
+// handlerUploadPart handles PATCH /api/videos/{videoID}/upload/{sessionID}.
+// It streams one Content-Range-addressed chunk of the video straight to S3
+// via UploadPart, without buffering the whole video on disk.
+func (cfg *apiConfig) handlerUploadPart(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("sessionID")
+	sess, ok := cfg.uploadSessions.Get(sessionID)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown or expired upload session", nil)
+		return
+	}
+
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+	videoID, err := uuid.Parse(sess.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Corrupt upload session", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to upload this video", nil)
+		return
+	}
+
+	offset, _, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or missing Content-Range header", err)
+		return
+	}
+	if offset != sess.NextOffset() {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Expected part starting at offset %d", sess.NextOffset()), nil)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxUploadPartSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read part body", err)
+		return
+	}
+	if int64(len(data)) > maxUploadPartSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Part exceeds maximum size", nil)
+		return
+	}
+
+	partNumber := sess.NextPartNumber()
+	uploaded, err := cfg.s3Client.UploadPart(r.Context(), &s3.UploadPartInput{
+		Bucket:     aws.String(cfg.s3Bucket),
+		Key:        aws.String(sess.S3Key),
+		UploadId:   aws.String(sess.UploadID),
+		PartNumber: aws.Int32(partNumber),
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload part", err)
+		return
+	}
+
+	newOffset := offset + int64(len(data))
+	_, _, err = cfg.uploadSessions.AddPart(sessionID, uploadsession.Part{
+		Number: partNumber,
+		ETag:   aws.ToString(uploaded.ETag),
+		Offset: newOffset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload session", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Offset int64 `json:"offset"`
+	}{Offset: newOffset})
+}
+
+// handlerCompleteUploadSession handles POST /api/videos/{videoID}/upload/complete.
+// It assembles the multipart upload in S3 and returns immediately with a
+// "processing" status; faststart/aspect-ratio processing and HLS
+// transcoding continue in the background, same as the direct upload path.
+func (cfg *apiConfig) handlerCompleteUploadSession(w http.ResponseWriter, r *http.Request) {
+	videoID, err := getVideoID(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to upload this video", nil)
+		return
+	}
+
+	var reqBody struct {
+		SessionID string `json:"sessionID"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse request body", err)
+		return
+	}
+	sess, ok := cfg.uploadSessions.Get(reqBody.SessionID)
+	if !ok || sess.VideoID != videoID.String() {
+		respondWithError(w, http.StatusNotFound, "Unknown or expired upload session", nil)
+		return
+	}
+
+	completedParts := make([]types.CompletedPart, len(sess.Parts))
+	for i, p := range sess.Parts {
+		completedParts[i] = types.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int32(p.Number),
+		}
+	}
+	_, err = cfg.s3Client.CompleteMultipartUpload(r.Context(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(cfg.s3Bucket),
+		Key:             aws.String(sess.S3Key),
+		UploadId:        aws.String(sess.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete multipart upload", err)
+		return
+	}
+	if err := cfg.uploadSessions.Delete(sess.ID); err != nil {
+		log.Printf("complete upload session %s: %v", sess.ID, err)
+	}
+
+	video.ProcessingStatus = "processing"
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save video to database", err)
+		return
+	}
+
+	go cfg.processMultipartVideo(videoID, sess.S3Key)
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, signedVideo)
+}
+
+// multipartProcessingTimeout bounds the background faststart/aspect-ratio
+// work kicked off by handlerCompleteUploadSession, since there's no HTTP
+// client left to cancel it if ffmpeg gets stuck.
+const multipartProcessingTimeout = 30 * time.Minute
+
+// processMultipartVideo downloads the assembled multipart object, runs it
+// through the same faststart/aspect-ratio/HLS pipeline as a direct upload,
+// and removes the raw assembled object once the final copy is in place.
+func (cfg *apiConfig) processMultipartVideo(videoID uuid.UUID, rawKey string) {
+	ctx, cancel := context.WithTimeout(context.Background(), multipartProcessingTimeout)
+	defer cancel()
+
+	tmpFile, err := os.CreateTemp("", "tubely-multipart-source.mp4")
+	if err != nil {
+		log.Printf("multipart upload %s: create temp file: %v", videoID, err)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	getObj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(rawKey),
+	})
+	if err != nil {
+		log.Printf("multipart upload %s: download assembled object: %v", videoID, err)
+		return
+	}
+	defer getObj.Body.Close()
+	if _, err := tmpFile.ReadFrom(getObj.Body); err != nil {
+		log.Printf("multipart upload %s: buffer assembled object: %v", videoID, err)
+		return
+	}
+
+	aspectRatio, err := getVideoAspectRatio(ctx, cfg, tmpFile.Name())
+	if err != nil {
+		log.Printf("multipart upload %s: aspect ratio: %v", videoID, err)
+		return
+	}
+	processedFilename, err := processVideoForFastStart(ctx, cfg, tmpFile.Name())
+	if err != nil {
+		log.Printf("multipart upload %s: faststart: %v", videoID, err)
+		return
+	}
+	defer os.Remove(processedFilename)
+
+	hlsSourcePath, err := copyToTemp(processedFilename)
+	if err != nil {
+		log.Printf("multipart upload %s: copy hls source: %v", videoID, err)
+		return
+	}
+
+	if _, err := cfg.finalizeVideoUpload(ctx, videoID, processedFilename, hlsSourcePath, aspectRatio, "video/mp4"); err != nil {
+		log.Printf("multipart upload %s: finalize: %v", videoID, err)
+		return
+	}
+
+	_, err = cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(rawKey),
+	})
+	if err != nil {
+		log.Printf("multipart upload %s: delete raw object %s: %v", videoID, rawKey, err)
+	}
+}
+
+// abortUploadSession aborts the S3 multipart upload backing sess. It's
+// passed to uploadsession.RunJanitor as the Abort callback for sessions left
+// idle past their TTL.
+func (cfg *apiConfig) abortUploadSession(ctx context.Context, sess *uploadsession.Session) error {
+	_, err := cfg.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(cfg.s3Bucket),
+		Key:      aws.String(sess.S3Key),
+		UploadId: aws.String(sess.UploadID),
+	})
+	return err
+}
+
+// parseContentRange parses a "bytes start-end/total" Content-Range header
+// and returns the start offset and the declared total size.
+func parseContentRange(header string) (start, total int64, err error) {
+	var end int64
+	n, err := fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &total)
+	if err != nil || n != 3 {
+		return 0, 0, fmt.Errorf("invalid Content-Range header %q", header)
+	}
+	return start, total, nil
+}
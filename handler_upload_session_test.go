@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantStart int64
+		wantTotal int64
+		wantErr   bool
+	}{
+		{
+			name:      "valid range",
+			header:    "bytes 0-15/32",
+			wantStart: 0,
+			wantTotal: 32,
+		},
+		{
+			name:      "valid mid-stream range",
+			header:    "bytes 16777216-33554431/104857600",
+			wantStart: 16777216,
+			wantTotal: 104857600,
+		},
+		{
+			name:    "missing total",
+			header:  "bytes 0-15",
+			wantErr: true,
+		},
+		{
+			name:    "wrong unit",
+			header:  "items 0-15/32",
+			wantErr: true,
+		},
+		{
+			name:    "empty header",
+			header:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, total, err := parseContentRange(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseContentRange(%q) expected an error, got start=%d total=%d", tt.header, start, total)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseContentRange(%q) unexpected error: %v", tt.header, err)
+			}
+			if start != tt.wantStart || total != tt.wantTotal {
+				t.Errorf("parseContentRange(%q) = (%d, %d), want (%d, %d)", tt.header, start, total, tt.wantStart, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"io"
 	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/google/uuid"
 )
@@ -68,24 +68,30 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	}
 
 	ext := strings.Split(mediaType, "/")[1]
-	filename := fmt.Sprintf("%v.%s", videoID, ext)
-	f, err := os.Create(filepath.Join(cfg.assetsRoot, filename))
+	key := fmt.Sprintf("thumbnails/%v.%s", videoID, ext)
+	_, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(mediaType),
+		Body:        bytes.NewReader(data),
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create file", err)
-		return
-	}
-	_, err = io.Copy(f, bytes.NewReader(data))
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't write file", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload thumbnail", err)
 		return
 	}
 
-	url := fmt.Sprintf("http://localhost:8091/assets/%v.%s", videoID, ext)
-	video.ThumbnailURL = &url
+	// Store the bare S3 key, same as every other ThumbnailURL producer;
+	// it's (re)signed on every response via cfg.dbVideoToSignedVideo.
+	video.ThumbnailURL = &key
 	if err := cfg.db.UpdateVideo(video); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
 }
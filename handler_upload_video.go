@@ -1,26 +1,29 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
-	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcode"
 	"github.com/google/uuid"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 )
 
 // handlerUploadVideo provides a handler for video uploads. It retrieves the
 // ID of the video from the URL and the user from the token, validates that
 // the user has permission to upload the video, processes the video for fast
 // start and uploads the processed file to s3 storage for later retrieval.
+// HLS renditions are transcoded asynchronously on cfg.transcodeQueue, so the
+// response comes back with ProcessingStatus "processing" rather than waiting
+// on ffmpeg to produce the full rendition ladder.
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	var uploadLimit int64 = 1 << 30
 	http.MaxBytesReader(w, r.Body, uploadLimit)
@@ -43,11 +46,13 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
 	}
 
 	// Verify ownership of the video
 	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "You are not authorized to upload this video", err)
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to upload this video", nil)
+		return
 	}
 
 	// Get the uploaded video file
@@ -69,6 +74,7 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	tmpFile, err := os.CreateTemp("", "tubely-upload.mp4")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create temp file", err)
+		return
 	}
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
@@ -82,96 +88,205 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	tmpFile.Seek(0, io.SeekStart)
 
 	// Get the aspect ratio of the video
-	aspectRatio, err := getVideoAspectRatio(tmpFile.Name())
+	aspectRatio, err := getVideoAspectRatio(r.Context(), cfg, tmpFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get aspect ratio", err)
+		return
 	}
 
-	processedFilename, err := processVideoForFastStart(tmpFile.Name())
+	processedFilename, err := processVideoForFastStart(r.Context(), cfg, tmpFile.Name())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't process video", err)
+		return
 	}
 
-	body, err := os.Open(processedFilename)
+	// hlsSourcePath is a copy of the processed file so the async HLS job has
+	// its own file to transcode from once finalizeVideoUpload consumes
+	// processedFilename for the mp4 upload.
+	hlsSourcePath, err := copyToTemp(processedFilename)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't open fast start processed file", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't prepare file for HLS transcoding", err)
+		return
 	}
 	defer os.Remove(processedFilename)
+
+	video, err = cfg.finalizeVideoUpload(r.Context(), videoID, processedFilename, hlsSourcePath, aspectRatio, mediaType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't finalize video upload", err)
+		return
+	}
+
+	// Write the success response with signed URLs; the DB keeps bare keys.
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// finalizeVideoUpload uploads the fast-start-processed file at
+// processedFilename to its aspect-ratio-keyed S3 location, saves the key on
+// the video record, and kicks off async HLS rendition transcoding from
+// hlsSourcePath (which finalizeVideoUpload's caller no longer owns once this
+// returns). It's shared by the direct upload handler and the multipart
+// upload-complete handler.
+func (cfg *apiConfig) finalizeVideoUpload(ctx context.Context, videoID uuid.UUID, processedFilename, hlsSourcePath, aspectRatio, mediaType string) (database.Video, error) {
+	// Until the HLS job is enqueued (which hands the file to the queue),
+	// hlsSourcePath is ours to clean up on an early error return.
+	enqueued := false
+	defer func() {
+		if !enqueued {
+			os.Remove(hlsSourcePath)
+		}
+	}()
+
+	body, err := os.Open(processedFilename)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("open processed file: %w", err)
+	}
 	defer body.Close()
 
-	// Upload the video to S3
 	key := make([]byte, 32)
 	_, _ = rand.Read(key)
 	filename := fmt.Sprintf("%s/%x.mp4", aspectRatio, key)
-	params := &s3.PutObjectInput{
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(cfg.s3Bucket),
 		Key:         aws.String(filename),
 		ContentType: aws.String(mediaType),
 		Body:        body,
+	})
+	if err != nil {
+		return database.Video{}, fmt.Errorf("upload video: %w", err)
+	}
+
+	// Store the video's S3 key (not a URL) in the database; VideoURL is
+	// (re)signed into a playable URL on every response, since it may expire.
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("reload video: %w", err)
+	}
+	video.VideoURL = &filename
+	video.ProcessingStatus = "processing"
+
+	// Auto-generated thumbnail candidates are best-effort: a failure here
+	// shouldn't fail the whole upload, since the user can still upload a
+	// thumbnail manually via handlerUploadThumbnail.
+	if candidates, thumbErr := generateThumbnailCandidates(ctx, cfg, videoID, processedFilename); thumbErr != nil {
+		log.Printf("thumbnail generation failed for video %s: %v", videoID, thumbErr)
+	} else {
+		video.ThumbnailCandidates = candidates
+	}
+
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		return database.Video{}, fmt.Errorf("save video: %w", err)
 	}
-	_, err = cfg.s3Client.PutObject(context.TODO(), params)
+
+	// Kick off HLS rendition transcoding in the background; the caller
+	// doesn't wait on it. The client polls GetVideo until HLSMasterURL and
+	// ProcessingStatus reflect the finished job.
+	enqueued = true
+	cfg.transcodeQueue.Enqueue(transcode.Job{
+		VideoID:    videoID.String(),
+		SourcePath: hlsSourcePath,
+		KeyPrefix:  fmt.Sprintf("hls/%s", videoID),
+	}, func(result transcode.Result) {
+		v, err := cfg.db.GetVideo(videoID)
+		if err != nil {
+			log.Printf("hls transcode: reload video %s: %v", result.VideoID, err)
+			return
+		}
+		if result.Err != nil {
+			log.Printf("hls transcode failed for video %s: %v", result.VideoID, result.Err)
+			v.ProcessingStatus = "failed"
+			_ = cfg.db.UpdateVideo(v)
+			return
+		}
+		v.HLSMasterURL = &result.HLSMasterKey
+		v.ProcessingStatus = "ready"
+		if err := cfg.db.UpdateVideo(v); err != nil {
+			log.Printf("hls transcode: save video %s: %v", result.VideoID, err)
+		}
+	})
+
+	return video, nil
+}
+
+// dbVideoToSignedVideo returns a copy of video with every S3-key field
+// (VideoURL, HLSMasterURL, ThumbnailURL, and each ThumbnailCandidates[i].Key)
+// rewritten into a signed, time-limited URL via cfg.cdnSigner. Callers must
+// use the returned copy for API responses and keep the DB record (with bare
+// keys) untouched; it's (re)signed on every GetVideo/GetVideos response
+// since a signed URL expires.
+func (cfg *apiConfig) dbVideoToSignedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	signed, err := cfg.signKey(ctx, video.VideoURL)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't upload video", err)
-		return
+		return database.Video{}, fmt.Errorf("sign video URL: %w", err)
 	}
+	video.VideoURL = signed
 
-	// Store the video metadata in the database
-	videoUrl := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, filename)
-	video.VideoURL = &videoUrl
-	if err = cfg.db.UpdateVideo(video); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't save video to database", err)
-		return
+	signed, err = cfg.signKey(ctx, video.HLSMasterURL)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("sign HLS master URL: %w", err)
+	}
+	video.HLSMasterURL = signed
+
+	signed, err = cfg.signKey(ctx, video.ThumbnailURL)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("sign thumbnail URL: %w", err)
+	}
+	video.ThumbnailURL = signed
+
+	if len(video.ThumbnailCandidates) > 0 {
+		candidates := make([]ThumbnailCandidate, len(video.ThumbnailCandidates))
+		copy(candidates, video.ThumbnailCandidates)
+		for i, candidate := range candidates {
+			signedKey, err := cfg.cdnSigner.SignedURL(ctx, candidate.Key)
+			if err != nil {
+				return database.Video{}, fmt.Errorf("sign thumbnail candidate %d: %w", i, err)
+			}
+			candidates[i].Key = signedKey
+		}
+		video.ThumbnailCandidates = candidates
 	}
 
-	// Write the success response
-	respondWithJSON(w, http.StatusOK, video)
+	return video, nil
 }
 
-// processVideoForFastStart uses ffmpeg to re-order the metadata in the video
-// using ffmpeg so that the movflags appear at the beginning of the file,
-// removing the need for two requests to preload the video content in the
-// browser.
-func processVideoForFastStart(filepath string) (string, error) {
-	outputFilepath := filepath + ".processing"
-	cmd := exec.Command("ffmpeg", "-i", filepath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilepath)
-	err := cmd.Run()
+// signKey returns a signed URL for the S3 key pointed to by key. If key is
+// nil or points to an empty string (a field that hasn't been set yet, e.g.
+// HLSMasterURL before transcoding finishes), it returns key unchanged.
+func (cfg *apiConfig) signKey(ctx context.Context, key *string) (*string, error) {
+	if key == nil || *key == "" {
+		return key, nil
+	}
+	signedURL, err := cfg.cdnSigner.SignedURL(ctx, *key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return outputFilepath, nil
+	return &signedURL, nil
 }
 
-// getVideoAspectRatio retrieves the video's aspect ratio from the metadata
-// using ffprobe.
-func getVideoAspectRatio(filePath string) (string, error) {
-	type videoData struct {
-		Streams []struct {
-			Width              int    `json:"width"`
-			Height             int    `json:"height"`
-			DisplayAspectRatio string `json:"display_aspect_ratio"`
-		} `json:"streams"`
-	}
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	buffer := bytes.NewBuffer(nil)
-	cmd.Stdout = buffer
-	err := cmd.Run()
+// copyToTemp copies the file at path into a new temp file and returns the
+// new file's path.
+func copyToTemp(path string) (string, error) {
+	src, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
-	var data videoData
-	err = json.Unmarshal(buffer.Bytes(), &data)
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "tubely-hls-source.mp4")
 	if err != nil {
 		return "", err
 	}
+	defer dst.Close()
 
-	ratio := data.Streams[0].DisplayAspectRatio
-	if ratio == "16:9" {
-		return "landscape", nil
-	} else if ratio == "9:16" {
-		return "portrait", nil
-	} else {
-		return "other", nil
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return "", err
 	}
+	return dst.Name(), nil
 }
 
 // getVideoID converts the parameter to a UUID
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/peaks"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/stderrtail"
+)
+
+// handlerGetVideoPeaks streams waveform peak generation progress to the
+// client as newline-delimited JSON (`{"progress":0.42}`), then a final line
+// carrying the peak array and its metadata. If peaks were already generated
+// for this video, it skips straight to the final line.
+func (cfg *apiConfig) handlerGetVideoPeaks(w http.ResponseWriter, r *http.Request) {
+	videoID, err := getVideoID(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to view this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusBadRequest, "Video has no uploaded media yet", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	writeLine := func(v any) {
+		_ = json.NewEncoder(w).Encode(v)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	binKey := fmt.Sprintf("peaks/%s.bin", videoID)
+	metaKey := fmt.Sprintf("peaks/%s.json", videoID)
+	if result, ok := cfg.loadCachedPeaks(r.Context(), binKey, metaKey); ok {
+		writeLine(peaksResponse(result))
+		return
+	}
+
+	tmpFile, err := os.CreateTemp("", "tubely-peaks-source.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create temp file", err)
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	getObj, err := cfg.s3Client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(*video.VideoURL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't fetch video from storage", err)
+		return
+	}
+	defer getObj.Body.Close()
+	if _, err := tmpFile.ReadFrom(getObj.Body); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't buffer video for processing", err)
+		return
+	}
+
+	duration, err := probeDuration(r.Context(), cfg, tmpFile.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't determine video duration", err)
+		return
+	}
+
+	result, err := peaks.Generate(r.Context(), cfg.ffmpegSem, tmpFile.Name(), duration, peaks.DefaultBucketSize, func(progress float64) {
+		writeLine(map[string]float64{"progress": progress})
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate peaks", err)
+		return
+	}
+
+	if err := cfg.storePeaks(r.Context(), binKey, metaKey, result); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save peaks", err)
+		return
+	}
+
+	writeLine(peaksResponse(result))
+}
+
+func peaksResponse(result peaks.Result) map[string]any {
+	return map[string]any{
+		"progress": 1.0,
+		"metadata": result.Metadata,
+		"peaks":    result.Peaks,
+	}
+}
+
+// loadCachedPeaks returns a previously generated peaks blob for this video,
+// if one exists in S3.
+func (cfg *apiConfig) loadCachedPeaks(ctx context.Context, binKey, metaKey string) (peaks.Result, bool) {
+	metaObj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(cfg.s3Bucket), Key: aws.String(metaKey)})
+	if err != nil {
+		return peaks.Result{}, false
+	}
+	defer metaObj.Body.Close()
+	var metadata peaks.Metadata
+	if err := json.NewDecoder(metaObj.Body).Decode(&metadata); err != nil {
+		return peaks.Result{}, false
+	}
+
+	binObj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(cfg.s3Bucket), Key: aws.String(binKey)})
+	if err != nil {
+		return peaks.Result{}, false
+	}
+	defer binObj.Body.Close()
+	buf := bytes.NewBuffer(nil)
+	if _, err := buf.ReadFrom(binObj.Body); err != nil {
+		return peaks.Result{}, false
+	}
+
+	return peaks.Result{Metadata: metadata, Peaks: peaks.DecodeBinary(buf.Bytes())}, true
+}
+
+// storePeaks uploads the binary peaks blob and its JSON metadata sidecar to
+// S3 alongside the video's mp4.
+func (cfg *apiConfig) storePeaks(ctx context.Context, binKey, metaKey string, result peaks.Result) error {
+	metaBytes, err := peaks.MarshalMetadata(result.Metadata)
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(metaKey),
+		ContentType: aws.String("application/json"),
+		Body:        bytes.NewReader(metaBytes),
+	}); err != nil {
+		return err
+	}
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(binKey),
+		ContentType: aws.String("application/octet-stream"),
+		Body:        bytes.NewReader(peaks.EncodeBinary(result.Peaks)),
+	})
+	return err
+}
+
+// probeDuration returns a media file's duration in seconds via ffprobe. It
+// respects cfg.ffmpegSem like the direct-upload ffmpeg helpers in ffmpeg.go.
+func probeDuration(ctx context.Context, cfg *apiConfig, filePath string) (float64, error) {
+	if err := acquireFFmpegSlot(ctx, cfg); err != nil {
+		return 0, fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer releaseFFmpegSlot(cfg)
+
+	type formatData struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", filePath)
+	buffer := bytes.NewBuffer(nil)
+	var stderr stderrtail.Tail
+	cmd.Stdout = buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe: %w: %s", err, stderr.String())
+	}
+	var data formatData
+	if err := json.Unmarshal(buffer.Bytes(), &data); err != nil {
+		return 0, err
+	}
+	var duration float64
+	if _, err := fmt.Sscanf(data.Format.Duration, "%f", &duration); err != nil {
+		return 0, fmt.Errorf("parse duration %q: %w", data.Format.Duration, err)
+	}
+	return duration, nil
+}
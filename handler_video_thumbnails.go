@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/stderrtail"
+	"github.com/google/uuid"
+)
+
+// ThumbnailCandidate is one auto-generated video frame offered to the user
+// to pick as the video's thumbnail.
+type ThumbnailCandidate struct {
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// thumbnailTimestampFractions are the points along the video's duration
+// where candidate thumbnail frames are captured.
+var thumbnailTimestampFractions = []float64{0.1, 0.5, 0.9}
+
+// generateThumbnailCandidates captures a frame at each of
+// thumbnailTimestampFractions, uploads each to S3 under
+// thumbnails/<videoID>/<n>.jpg, and returns their keys and dimensions.
+func generateThumbnailCandidates(ctx context.Context, cfg *apiConfig, videoID uuid.UUID, sourcePath string) ([]ThumbnailCandidate, error) {
+	duration, err := probeDuration(ctx, cfg, sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("probe duration: %w", err)
+	}
+
+	candidates := make([]ThumbnailCandidate, 0, len(thumbnailTimestampFractions))
+	for i, frac := range thumbnailTimestampFractions {
+		candidate, err := captureAndUploadThumbnail(ctx, cfg, videoID, sourcePath, i, duration*frac)
+		if err != nil {
+			return nil, fmt.Errorf("thumbnail %d: %w", i, err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// captureAndUploadThumbnail extracts a single JPEG frame at timestampSeconds,
+// uploads it to S3, and returns the resulting candidate.
+func captureAndUploadThumbnail(ctx context.Context, cfg *apiConfig, videoID uuid.UUID, sourcePath string, index int, timestampSeconds float64) (ThumbnailCandidate, error) {
+	outPath, err := captureThumbnailFrame(ctx, cfg, sourcePath, timestampSeconds)
+	if err != nil {
+		return ThumbnailCandidate{}, fmt.Errorf("capture frame: %w", err)
+	}
+	defer os.Remove(outPath)
+
+	width, height, err := probeImageDimensions(ctx, cfg, outPath)
+	if err != nil {
+		return ThumbnailCandidate{}, fmt.Errorf("probe dimensions: %w", err)
+	}
+
+	file, err := os.Open(outPath)
+	if err != nil {
+		return ThumbnailCandidate{}, fmt.Errorf("open frame: %w", err)
+	}
+	defer file.Close()
+
+	key := fmt.Sprintf("thumbnails/%s/%d.jpg", videoID, index)
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String("image/jpeg"),
+		Body:        file,
+	})
+	if err != nil {
+		return ThumbnailCandidate{}, fmt.Errorf("upload: %w", err)
+	}
+
+	return ThumbnailCandidate{Key: key, Width: width, Height: height}, nil
+}
+
+// captureThumbnailFrame extracts a single scaled JPEG frame at
+// timestampSeconds and returns its temp file path. It respects
+// cfg.ffmpegSem like the direct-upload ffmpeg helpers in ffmpeg.go.
+func captureThumbnailFrame(ctx context.Context, cfg *apiConfig, sourcePath string, timestampSeconds float64) (string, error) {
+	if err := acquireFFmpegSlot(ctx, cfg); err != nil {
+		return "", fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer releaseFFmpegSlot(cfg)
+
+	out, err := os.CreateTemp("", "tubely-thumb-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	outPath := out.Name()
+	out.Close()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-y",
+		"-ss", fmt.Sprintf("%f", timestampSeconds),
+		"-i", sourcePath,
+		"-vframes", "1",
+		"-vf", "scale=640:-1",
+		outPath,
+	)
+	var stderr stderrtail.Tail
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outPath)
+		return "", fmt.Errorf("ffmpeg: %w: %s", err, stderr.String())
+	}
+	return outPath, nil
+}
+
+// probeImageDimensions returns a JPEG's width and height via ffprobe. It
+// respects cfg.ffmpegSem like the direct-upload ffmpeg helpers in ffmpeg.go.
+func probeImageDimensions(ctx context.Context, cfg *apiConfig, filePath string) (width, height int, err error) {
+	if err := acquireFFmpegSlot(ctx, cfg); err != nil {
+		return 0, 0, fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer releaseFFmpegSlot(cfg)
+
+	type imageData struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+	}
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	buffer := bytes.NewBuffer(nil)
+	var stderr stderrtail.Tail
+	cmd.Stdout = buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, 0, fmt.Errorf("ffprobe: %w: %s", err, stderr.String())
+	}
+	var data imageData
+	if err := json.Unmarshal(buffer.Bytes(), &data); err != nil {
+		return 0, 0, err
+	}
+	if len(data.Streams) == 0 {
+		return 0, 0, fmt.Errorf("no image stream found")
+	}
+	return data.Streams[0].Width, data.Streams[0].Height, nil
+}
+
+// handlerSelectThumbnail handles POST /api/videos/{videoID}/thumbnail/select.
+// It sets ThumbnailURL to one of the video's auto-generated
+// ThumbnailCandidates, chosen by the request body's candidate key.
+func (cfg *apiConfig) handlerSelectThumbnail(w http.ResponseWriter, r *http.Request) {
+	videoID, err := getVideoID(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to modify this video", nil)
+		return
+	}
+
+	var reqBody struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse request body", err)
+		return
+	}
+
+	var selected *ThumbnailCandidate
+	for i := range video.ThumbnailCandidates {
+		if video.ThumbnailCandidates[i].Key == reqBody.Key {
+			selected = &video.ThumbnailCandidates[i]
+			break
+		}
+	}
+	if selected == nil {
+		respondWithError(w, http.StatusBadRequest, "Unknown thumbnail candidate", nil)
+		return
+	}
+
+	// Store the bare S3 key, same as VideoURL; ThumbnailURL is (re)signed on
+	// every response via cfg.dbVideoToSignedVideo, not baked in here.
+	key := selected.Key
+	video.ThumbnailURL = &key
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save video to database", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
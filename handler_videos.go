@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// handlerVideoGet handles GET /api/videos/{videoID}. Like every other
+// handler in this series, it's owner-only: signed URLs are meant to be
+// time-limited and access-controlled, not handed out to anyone who guesses
+// a videoID. It returns the video with all S3-key fields (re)signed via
+// cfg.dbVideoToSignedVideo, since keys stored in the database aren't
+// directly fetchable once the bucket requires signed access.
+func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+	videoID, err := getVideoID(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "You are not authorized to view this video", nil)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signedVideo)
+}
+
+// handlerVideosRetrieve handles GET /api/videos. It returns the videos
+// owned by the authenticated user, each (re)signed the same way as
+// handlerVideoGet. A video whose URLs fail to sign is logged and left out
+// of the response.
+func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserID(cfg, r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid user ID", err)
+		return
+	}
+
+	videos, err := cfg.db.GetVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	signedVideos := make([]any, 0, len(videos))
+	for _, video := range videos {
+		signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			log.Printf("sign video %s: %v", video.ID, err)
+			continue
+		}
+		signedVideos = append(signedVideos, signedVideo)
+	}
+	respondWithJSON(w, http.StatusOK, signedVideos)
+}
@@ -0,0 +1,43 @@
+package cdn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate test RSA key: %v", err)
+	}
+	return key
+}
+
+func TestSignedURLCloudFront(t *testing.T) {
+	signer := NewSigner("my-bucket", time.Hour, "cdn.example.com", "keypair-id", mustGenerateKey(t), nil)
+
+	signed, err := signer.SignedURL(context.Background(), "videos/landscape/abc123.mp4")
+	if err != nil {
+		t.Fatalf("SignedURL() error = %v", err)
+	}
+	if !strings.HasPrefix(signed, "https://cdn.example.com/videos/landscape/abc123.mp4") {
+		t.Errorf("SignedURL() = %q, want prefix https://cdn.example.com/videos/landscape/abc123.mp4", signed)
+	}
+	if !strings.Contains(signed, "Key-Pair-Id=keypair-id") {
+		t.Errorf("SignedURL() = %q, want a Key-Pair-Id=keypair-id query param", signed)
+	}
+}
+
+func TestSignedURLNoConfigNoPresignClient(t *testing.T) {
+	signer := NewSigner("my-bucket", time.Hour, "", "", nil, nil)
+
+	_, err := signer.SignedURL(context.Background(), "videos/landscape/abc123.mp4")
+	if err == nil {
+		t.Fatal("SignedURL() expected an error when neither CloudFront nor a presign client is configured")
+	}
+}
@@ -0,0 +1,45 @@
+// Package ffmpeglimit bounds how many ffmpeg/ffprobe subprocesses run at
+// once across the whole app, so concurrent uploads, HLS transcodes, and peak
+// extractions don't all spawn processes of their own and thrash the host.
+package ffmpeglimit
+
+import "context"
+
+// Limiter is implemented by *Semaphore. Packages that shell out to
+// ffmpeg/ffprobe depend on this interface rather than the concrete type, so
+// they don't need to import this package's construction details and can be
+// handed a fake in tests.
+type Limiter interface {
+	Acquire(ctx context.Context) error
+	Release()
+}
+
+// Semaphore is a Limiter backed by a buffered channel.
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// New returns a Semaphore allowing up to n concurrent holders. n < 1 is
+// treated as 1.
+func New(n int) *Semaphore {
+	if n < 1 {
+		n = 1
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is free or ctx is done (e.g. the caller gave
+// up waiting).
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot acquired by Acquire.
+func (s *Semaphore) Release() {
+	<-s.slots
+}
@@ -0,0 +1,56 @@
+package ffmpeglimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreBoundsConcurrency(t *testing.T) {
+	sem := New(2)
+	ctx := context.Background()
+
+	if err := sem.Acquire(ctx); err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	if err := sem.Acquire(ctx); err != nil {
+		t.Fatalf("second Acquire: %v", err)
+	}
+
+	blockedCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(blockedCtx); err == nil {
+		t.Fatal("third Acquire should have blocked until a slot was released")
+	}
+
+	sem.Release()
+	if err := sem.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+}
+
+func TestSemaphoreNewClampsToOne(t *testing.T) {
+	sem := New(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := sem.Acquire(context.Background()); err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	if err := sem.Acquire(ctx); err == nil {
+		t.Fatal("New(0) should behave like New(1): second Acquire should block")
+	}
+}
+
+func TestSemaphoreAcquireRespectsContextCancellation(t *testing.T) {
+	sem := New(1)
+	if err := sem.Acquire(context.Background()); err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sem.Acquire(ctx); err == nil {
+		t.Fatal("Acquire with an already-canceled context should return an error")
+	}
+}
@@ -0,0 +1,187 @@
+// Package peaks extracts waveform min/max peak pairs from a video's audio
+// track so the frontend can render a scrubbable waveform preview without
+// downloading the whole file.
+package peaks
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeglimit"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/stderrtail"
+)
+
+// DefaultSampleRate is the rate ffmpeg downmixes audio to before peak
+// extraction; it's far more resolution than a waveform needs, which keeps
+// the ffmpeg decode fast.
+const DefaultSampleRate = 8000
+
+// DefaultBucketSize is the number of PCM samples folded into each min/max
+// pair when the caller doesn't specify one.
+const DefaultBucketSize = 1000
+
+// Metadata describes a generated peaks blob.
+type Metadata struct {
+	SampleRate int `json:"sampleRate"`
+	Channels   int `json:"channels"`
+	Bits       int `json:"bits"`
+	Length     int `json:"length"` // number of (min, max) pairs
+}
+
+// Result is a completed peaks extraction.
+type Result struct {
+	Metadata Metadata
+	Peaks    []int16 // interleaved min, max pairs; len == Metadata.Length*2
+}
+
+// Generate runs ffmpeg over sourcePath to extract raw mono 16-bit PCM audio
+// and downsamples it into peaks, reporting fractional progress (0..1) via
+// onProgress as the PCM stream comes in. durationSeconds (from ffprobe) is
+// used to estimate progress without buffering the whole stream first;
+// onProgress may be nil. limiter bounds concurrent ffmpeg subprocesses
+// across the whole app, not just peak extraction.
+func Generate(ctx context.Context, limiter ffmpeglimit.Limiter, sourcePath string, durationSeconds float64, bucketSize int, onProgress func(float64)) (Result, error) {
+	if err := limiter.Acquire(ctx); err != nil {
+		return Result{}, fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer limiter.Release()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", sourcePath,
+		"-f", "s16le",
+		"-ac", "1",
+		"-ar", strconv.Itoa(DefaultSampleRate),
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return Result{}, fmt.Errorf("open ffmpeg stdout: %w", err)
+	}
+	var stderr stderrtail.Tail
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return Result{}, fmt.Errorf("start ffmpeg: %w", err)
+	}
+
+	expectedBytes := int64(durationSeconds * DefaultSampleRate * 2) // 16-bit mono
+	reader := &progressReader{r: stdout, total: expectedBytes, onProgress: onProgress}
+
+	result, extractErr := Extract(reader, bucketSize)
+	waitErr := cmd.Wait()
+	if extractErr != nil {
+		return Result{}, fmt.Errorf("extract peaks: %w", extractErr)
+	}
+	if waitErr != nil {
+		return Result{}, fmt.Errorf("ffmpeg: %w: %s", waitErr, stderr.String())
+	}
+	if onProgress != nil {
+		onProgress(1.0)
+	}
+	return result, nil
+}
+
+// Extract reads a raw signed 16-bit little-endian mono PCM stream (as
+// produced by `ffmpeg -f s16le -ac 1 -ar 8000`) and folds it into min/max
+// peak pairs, one pair per bucketSize input samples.
+func Extract(r io.Reader, bucketSize int) (Result, error) {
+	if bucketSize < 1 {
+		bucketSize = DefaultBucketSize
+	}
+
+	br := bufio.NewReader(r)
+	var peaks []int16
+	sampleBuf := make([]byte, 2)
+	var bucketMin, bucketMax int16
+	inBucket := 0
+
+	for {
+		_, err := io.ReadFull(br, sampleBuf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("read pcm sample: %w", err)
+		}
+		sample := int16(binary.LittleEndian.Uint16(sampleBuf))
+
+		if inBucket == 0 {
+			bucketMin, bucketMax = sample, sample
+		} else if sample < bucketMin {
+			bucketMin = sample
+		} else if sample > bucketMax {
+			bucketMax = sample
+		}
+
+		inBucket++
+		if inBucket == bucketSize {
+			peaks = append(peaks, bucketMin, bucketMax)
+			inBucket = 0
+		}
+	}
+	if inBucket > 0 {
+		peaks = append(peaks, bucketMin, bucketMax)
+	}
+
+	return Result{
+		Metadata: Metadata{
+			SampleRate: DefaultSampleRate,
+			Channels:   1,
+			Bits:       16,
+			Length:     len(peaks) / 2,
+		},
+		Peaks: peaks,
+	}, nil
+}
+
+// EncodeBinary serializes peaks as little-endian int16s, the format stored
+// in S3 alongside the JSON metadata sidecar.
+func EncodeBinary(peaks []int16) []byte {
+	buf := make([]byte, len(peaks)*2)
+	for i, p := range peaks {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(p))
+	}
+	return buf
+}
+
+// DecodeBinary is the inverse of EncodeBinary.
+func DecodeBinary(data []byte) []int16 {
+	peaks := make([]int16, len(data)/2)
+	for i := range peaks {
+		peaks[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return peaks
+}
+
+// MarshalMetadata renders Metadata as the JSON sidecar stored next to the
+// binary peaks blob.
+func MarshalMetadata(m Metadata) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// progressReader wraps an io.Reader and reports cumulative fractional
+// progress against an expected total byte count.
+type progressReader struct {
+	r          io.Reader
+	total      int64
+	read       int64
+	onProgress func(float64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.onProgress != nil && p.total > 0 {
+		frac := float64(p.read) / float64(p.total)
+		if frac > 1 {
+			frac = 1
+		}
+		p.onProgress(frac)
+	}
+	return n, err
+}
@@ -0,0 +1,89 @@
+package peaks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func pcmSamples(samples ...int16) []byte {
+	buf := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name       string
+		samples    []int16
+		bucketSize int
+		wantPeaks  []int16
+		wantLength int
+	}{
+		{
+			name:       "exact multiple of bucket size",
+			samples:    []int16{1, -3, 2, 5, -1, 0},
+			bucketSize: 3,
+			wantPeaks:  []int16{-3, 2, -1, 5},
+			wantLength: 2,
+		},
+		{
+			name:       "trailing partial bucket is still emitted",
+			samples:    []int16{4, -4, 1},
+			bucketSize: 2,
+			wantPeaks:  []int16{-4, 4, 1, 1},
+			wantLength: 2,
+		},
+		{
+			name:       "no samples",
+			samples:    nil,
+			bucketSize: 4,
+			wantPeaks:  nil,
+			wantLength: 0,
+		},
+		{
+			name:       "bucketSize less than 1 falls back to DefaultBucketSize",
+			samples:    []int16{1, 2},
+			bucketSize: 0,
+			wantPeaks:  []int16{1, 2},
+			wantLength: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Extract(bytes.NewReader(pcmSamples(tt.samples...)), tt.bucketSize)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if result.Metadata.Length != tt.wantLength {
+				t.Errorf("Metadata.Length = %d, want %d", result.Metadata.Length, tt.wantLength)
+			}
+			if !int16SlicesEqual(result.Peaks, tt.wantPeaks) {
+				t.Errorf("Peaks = %v, want %v", result.Peaks, tt.wantPeaks)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeBinaryRoundTrip(t *testing.T) {
+	peaks := []int16{-32768, 0, 32767, -1}
+	decoded := DecodeBinary(EncodeBinary(peaks))
+	if !int16SlicesEqual(decoded, peaks) {
+		t.Errorf("round trip = %v, want %v", decoded, peaks)
+	}
+}
+
+func int16SlicesEqual(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
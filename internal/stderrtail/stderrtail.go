@@ -0,0 +1,26 @@
+// Package stderrtail captures the tail end of a subprocess's stderr so a
+// failing ffmpeg/ffprobe call can report useful diagnostic text without
+// risking an unbounded buffer on a runaway process.
+package stderrtail
+
+// maxBytes is how much trailing stderr output Tail keeps.
+const maxBytes = 4096
+
+// Tail is an io.Writer that keeps only the last maxBytes bytes written to
+// it. Attach it as an exec.Cmd's Stderr and include Tail.String() in the
+// error returned on a non-zero exit.
+type Tail struct {
+	buf []byte
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > maxBytes {
+		t.buf = t.buf[len(t.buf)-maxBytes:]
+	}
+	return len(p), nil
+}
+
+func (t *Tail) String() string {
+	return string(t.buf)
+}
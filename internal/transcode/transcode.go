@@ -0,0 +1,262 @@
+// Package transcode runs ffmpeg-based HLS transcoding jobs off the request
+// path so uploads can return before the (slow) rendition work is done.
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeglimit"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/stderrtail"
+)
+
+// Rendition describes a single HLS output quality level.
+type Rendition struct {
+	Name    string // e.g. "1080p", also used as the output subdirectory
+	Height  int
+	Bitrate string // ffmpeg -b:v value, e.g. "2800k"
+}
+
+// DefaultRenditions is attempted for every source video. Renditions taller
+// than the source resolution are skipped so we never upscale.
+var DefaultRenditions = []Rendition{
+	{Name: "1080p", Height: 1080, Bitrate: "5000k"},
+	{Name: "720p", Height: 720, Bitrate: "2800k"},
+	{Name: "480p", Height: 480, Bitrate: "1400k"},
+	{Name: "360p", Height: 360, Bitrate: "800k"},
+}
+
+// Uploader uploads a local file to object storage under key. Kept minimal so
+// this package doesn't need to know about the AWS SDK or apiConfig.
+type Uploader interface {
+	UploadFile(ctx context.Context, key, path, contentType string) error
+}
+
+// Job is a single video's transcode-and-publish request. SourcePath is owned
+// by the queue once submitted: it's removed after the job finishes.
+type Job struct {
+	VideoID    string
+	SourcePath string
+	KeyPrefix  string // e.g. "hls/<videoID>"
+}
+
+// Result is delivered to a Job's callback once transcoding finishes (or
+// fails).
+type Result struct {
+	VideoID      string
+	HLSMasterKey string
+	Err          error
+}
+
+// Queue runs transcode jobs on a fixed pool of workers so that concurrent
+// uploads don't spawn unbounded ffmpeg processes. Each job's ffmpeg/ffprobe
+// calls also acquire limiter, so the queue's own worker count composes with
+// a process-wide cap shared with other ffmpeg callers (e.g. direct uploads).
+type Queue struct {
+	jobs     chan jobWithCallback
+	uploader Uploader
+	limiter  ffmpeglimit.Limiter
+}
+
+type jobWithCallback struct {
+	job      Job
+	callback func(Result)
+}
+
+// NewQueue starts workers goroutines pulling jobs off an internal channel.
+// limiter bounds concurrent ffmpeg/ffprobe subprocesses across the whole
+// app, not just within this queue.
+func NewQueue(uploader Uploader, workers int, limiter ffmpeglimit.Limiter) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		jobs:     make(chan jobWithCallback, 32),
+		uploader: uploader,
+		limiter:  limiter,
+	}
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	return q
+}
+
+func (q *Queue) run() {
+	for jc := range q.jobs {
+		masterKey, err := process(context.Background(), q.uploader, q.limiter, jc.job)
+		jc.callback(Result{VideoID: jc.job.VideoID, HLSMasterKey: masterKey, Err: err})
+	}
+}
+
+// Enqueue submits a job for async processing. It returns without waiting
+// for the job to run, but blocks while the queue's 32-job buffer is full.
+// callback runs on a worker goroutine once the job completes or fails.
+func (q *Queue) Enqueue(job Job, callback func(Result)) {
+	q.jobs <- jobWithCallback{job: job, callback: callback}
+}
+
+// process transcodes the source into whichever renditions fit its
+// resolution, writes a master playlist, and uploads the whole tree.
+func process(ctx context.Context, uploader Uploader, limiter ffmpeglimit.Limiter, job Job) (string, error) {
+	defer os.Remove(job.SourcePath)
+
+	srcHeight, err := probeHeight(ctx, limiter, job.SourcePath)
+	if err != nil {
+		return "", fmt.Errorf("probe source: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "tubely-hls")
+	if err != nil {
+		return "", fmt.Errorf("create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	var variants []string
+	for _, r := range DefaultRenditions {
+		if r.Height > srcHeight {
+			continue
+		}
+		if err := transcodeRendition(ctx, limiter, job.SourcePath, workDir, r); err != nil {
+			return "", fmt.Errorf("transcode %s: %w", r.Name, err)
+		}
+		variants = append(variants, r.Name)
+	}
+	if len(variants) == 0 {
+		return "", fmt.Errorf("no rendition fits source height %dp", srcHeight)
+	}
+
+	masterPath := filepath.Join(workDir, "master.m3u8")
+	if err := writeMasterPlaylist(masterPath, variants); err != nil {
+		return "", fmt.Errorf("write master playlist: %w", err)
+	}
+
+	if err := uploadTree(ctx, uploader, workDir, job.KeyPrefix); err != nil {
+		return "", fmt.Errorf("upload hls tree: %w", err)
+	}
+
+	return job.KeyPrefix + "/master.m3u8", nil
+}
+
+// probeHeight returns the source video's pixel height via ffprobe.
+func probeHeight(ctx context.Context, limiter ffmpeglimit.Limiter, filePath string) (int, error) {
+	if err := limiter.Acquire(ctx); err != nil {
+		return 0, fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer limiter.Release()
+
+	type videoData struct {
+		Streams []struct {
+			Height int `json:"height"`
+		} `json:"streams"`
+	}
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	buffer := bytes.NewBuffer(nil)
+	var stderr stderrtail.Tail
+	cmd.Stdout = buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe: %w: %s", err, stderr.String())
+	}
+	var data videoData
+	if err := json.Unmarshal(buffer.Bytes(), &data); err != nil {
+		return 0, err
+	}
+	if len(data.Streams) == 0 {
+		return 0, fmt.Errorf("no video stream found")
+	}
+	return data.Streams[0].Height, nil
+}
+
+// transcodeRendition writes a single rendition's HLS playlist and segments
+// into workDir/<rendition name>/.
+func transcodeRendition(ctx context.Context, limiter ffmpeglimit.Limiter, sourcePath, workDir string, r Rendition) error {
+	if err := limiter.Acquire(ctx); err != nil {
+		return fmt.Errorf("wait for ffmpeg slot: %w", err)
+	}
+	defer limiter.Release()
+
+	renditionDir := filepath.Join(workDir, r.Name)
+	if err := os.Mkdir(renditionDir, 0o755); err != nil {
+		return err
+	}
+	playlist := filepath.Join(renditionDir, "rendition.m3u8")
+	segmentPattern := filepath.Join(renditionDir, "segment%03d.ts")
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", sourcePath,
+		"-vf", fmt.Sprintf("scale=-2:%d", r.Height),
+		"-b:v", r.Bitrate,
+		"-c:a", "aac",
+		"-hls_time", "6",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", segmentPattern,
+		playlist,
+	)
+	var stderr stderrtail.Tail
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// writeMasterPlaylist writes an HLS master playlist referencing each
+// rendition's own playlist, in the order variants are given (process passes
+// them in DefaultRenditions order, highest bitrate first).
+func writeMasterPlaylist(path string, variants []string) error {
+	byName := make(map[string]Rendition, len(DefaultRenditions))
+	for _, r := range DefaultRenditions {
+		byName[r.Name] = r
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, name := range variants {
+		r := byName[name]
+		bandwidth, err := bitrateToBandwidth(r.Bitrate)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n", bandwidth)
+		fmt.Fprintf(&buf, "%s/rendition.m3u8\n", name)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func bitrateToBandwidth(bitrate string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(bitrate, "k"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid bitrate %q: %w", bitrate, err)
+	}
+	return n * 1000, nil
+}
+
+// uploadTree uploads every file under root to keyPrefix, preserving the
+// relative directory layout (so e.g. 720p/rendition.m3u8 stays alongside its
+// segments).
+func uploadTree(ctx context.Context, uploader Uploader, root, keyPrefix string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := keyPrefix + "/" + filepath.ToSlash(rel)
+		contentType := "application/vnd.apple.mpegurl"
+		if strings.HasSuffix(path, ".ts") {
+			contentType = "video/mp2t"
+		}
+		return uploader.UploadFile(ctx, key, path, contentType)
+	})
+}
@@ -0,0 +1,81 @@
+package transcode
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBitrateToBandwidth(t *testing.T) {
+	tests := []struct {
+		name    string
+		bitrate string
+		want    int
+		wantErr bool
+	}{
+		{name: "kilobits suffix", bitrate: "2800k", want: 2800000},
+		{name: "smallest default rendition", bitrate: "800k", want: 800000},
+		{name: "no suffix is still parsed as a number", bitrate: "5000", want: 5000000},
+		{name: "not a number", bitrate: "fast", wantErr: true},
+		{name: "empty string", bitrate: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bitrateToBandwidth(tt.bitrate)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("bitrateToBandwidth(%q) expected an error, got %d", tt.bitrate, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("bitrateToBandwidth(%q) unexpected error: %v", tt.bitrate, err)
+			}
+			if got != tt.want {
+				t.Errorf("bitrateToBandwidth(%q) = %d, want %d", tt.bitrate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMasterPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "master.m3u8")
+
+	if err := writeMasterPlaylist(path, []string{"720p", "360p"}); err != nil {
+		t.Fatalf("writeMasterPlaylist() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read master playlist: %v", err)
+	}
+	content := string(data)
+
+	if !strings.HasPrefix(content, "#EXTM3U\n#EXT-X-VERSION:3\n") {
+		t.Errorf("master playlist missing header, got:\n%s", content)
+	}
+	if !strings.Contains(content, "#EXT-X-STREAM-INF:BANDWIDTH=2800000\n720p/rendition.m3u8\n") {
+		t.Errorf("master playlist missing 720p entry, got:\n%s", content)
+	}
+	if !strings.Contains(content, "#EXT-X-STREAM-INF:BANDWIDTH=800000\n360p/rendition.m3u8\n") {
+		t.Errorf("master playlist missing 360p entry, got:\n%s", content)
+	}
+
+	// Variants are written in the order given, not DefaultRenditions order.
+	if strings.Index(content, "720p/rendition.m3u8") > strings.Index(content, "360p/rendition.m3u8") {
+		t.Errorf("expected 720p entry before 360p entry, got:\n%s", content)
+	}
+}
+
+func TestWriteMasterPlaylistUnknownRenditionErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "master.m3u8")
+
+	err := writeMasterPlaylist(path, []string{"not-a-real-rendition"})
+	if err == nil {
+		t.Fatal("expected an error for a variant name with no matching Rendition (zero-value Bitrate fails to parse)")
+	}
+}
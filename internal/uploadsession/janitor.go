@@ -0,0 +1,36 @@
+package uploadsession
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Abort aborts the S3 multipart upload backing an idle session, e.g. via
+// s3.Client.AbortMultipartUpload. Implemented in package main so this
+// package doesn't need to import the AWS SDK.
+type Abort func(ctx context.Context, sess *Session) error
+
+// RunJanitor periodically aborts sessions idle past ttl and removes them
+// from store, so abandoned client uploads don't leave orphaned S3 multipart
+// uploads accumulating storage costs. It blocks until ctx is done.
+func RunJanitor(ctx context.Context, store *Store, ttl, interval time.Duration, abort Abort) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, sess := range store.IdleSince(time.Now().Add(-ttl)) {
+				if err := abort(ctx, sess); err != nil {
+					log.Printf("uploadsession janitor: abort session %s: %v", sess.ID, err)
+					continue
+				}
+				if err := store.Delete(sess.ID); err != nil {
+					log.Printf("uploadsession janitor: remove session %s: %v", sess.ID, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package uploadsession tracks in-progress resumable multipart uploads so a
+// client can reconnect after a dropped connection and keep streaming parts
+// instead of restarting from byte zero.
+package uploadsession
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Part records one uploaded chunk of a multipart upload.
+type Part struct {
+	Number int32
+	ETag   string
+	Offset int64 // byte offset just past this part's end, for resume
+}
+
+// Session is a single video's in-progress resumable upload.
+type Session struct {
+	ID         string
+	VideoID    string
+	S3Key      string
+	UploadID   string
+	Parts      []Part
+	LastActive time.Time
+}
+
+// NextOffset returns the byte offset the client should resume from: the end
+// of the last part received.
+func (s *Session) NextOffset() int64 {
+	if len(s.Parts) == 0 {
+		return 0
+	}
+	last := s.Parts[len(s.Parts)-1]
+	return last.Offset
+}
+
+// NextPartNumber returns the S3 part number for the next part to upload.
+// Part numbers are 1-indexed and must be contiguous.
+func (s *Session) NextPartNumber() int32 {
+	return int32(len(s.Parts)) + 1
+}
+
+// Store is a registry of in-flight upload sessions, keyed by session ID,
+// persisted to a JSON file on every mutation (the same flat-file table
+// convention internal/database uses for videos) so a server restart or
+// redeploy doesn't drop resumable uploads mid-transfer.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	sessions map[string]*Session
+}
+
+// NewStore opens (or creates) the session table at path and loads any
+// sessions left over from a previous run.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, sessions: make(map[string]*Session)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read upload session table: %w", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(data, &s.sessions); err != nil {
+		return nil, fmt.Errorf("parse upload session table: %w", err)
+	}
+	return s, nil
+}
+
+// Create registers a new session and persists it.
+func (s *Store) Create(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.LastActive = time.Now()
+	s.sessions[session.ID] = session
+	return s.persistLocked()
+}
+
+// Get returns a snapshot of the session with the given ID, if one exists.
+// The returned *Session is a copy: mutating it has no effect on the store,
+// and it's safe to read after the call even while another goroutine calls
+// AddPart on the same ID.
+func (s *Store) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	return cloneSession(sess), true
+}
+
+// AddPart appends a completed part to the session, bumps its activity
+// timestamp so the janitor leaves it alone, and persists the change. It
+// returns a snapshot of the updated session, safe for the caller to read
+// without further locking.
+func (s *Store) AddPart(id string, part Part) (*Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false, nil
+	}
+	sess.Parts = append(sess.Parts, part)
+	sess.LastActive = time.Now()
+	return cloneSession(sess), true, s.persistLocked()
+}
+
+// Delete removes a session, e.g. once its upload completes or is aborted,
+// and persists the removal.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return s.persistLocked()
+}
+
+// IdleSince returns snapshots of sessions that haven't received a part
+// since cutoff, for the janitor to abort.
+func (s *Store) IdleSince(cutoff time.Time) []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var idle []*Session
+	for _, sess := range s.sessions {
+		if sess.LastActive.Before(cutoff) {
+			idle = append(idle, cloneSession(sess))
+		}
+	}
+	return idle
+}
+
+// cloneSession returns a deep copy of sess so callers can read it outside
+// s.mu without racing a concurrent AddPart on the same session.
+func cloneSession(sess *Session) *Session {
+	clone := *sess
+	clone.Parts = append([]Part(nil), sess.Parts...)
+	return &clone
+}
+
+// persistLocked writes the full session table to disk. Callers must hold
+// s.mu.
+func (s *Store) persistLocked() error {
+	data, err := json.MarshalIndent(s.sessions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal upload session table: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("write upload session table: %w", err)
+	}
+	return nil
+}